@@ -0,0 +1,31 @@
+// Package opjale implements label encryption (LE) for the Open Private
+// Join Agreement: HPKE-authenticated sealing and opening of match labels
+// between a matching system and a DSP, plus the supporting JWE
+// serialization, key export/import, key rotation, and streaming/batch
+// sealing helpers built on top of it.
+//
+// # Authentication and Rewrap
+//
+// Every Sealer/Opener pair created by NewSender/NewReceiver (directly or
+// via KeyringSender/KeyringReceiver) authenticates its ciphertexts to a
+// specific sender public key: the sPKBytes passed to NewReceiver or
+// Keyring.Rewrap must be the public key of whichever party actually holds
+// the matching private key used to seal, or Open fails.
+//
+// For every ciphertext except one produced by Keyring.Rewrap, that sender
+// is the original external party (the matching system sealing to a DSP,
+// or vice versa), and sPKBytes is that party's public key.
+//
+// Keyring.Rewrap is the exception: it re-encrypts a label under a new key
+// version without ever exposing the recovered plaintext to the caller, so
+// it can't re-seal under the original external sender's identity (it
+// doesn't hold that party's private key). Instead it authenticates the
+// rewrapped ciphertext under the Keyring's own key at the version the
+// label was previously wrapped to. A caller opening a rewrapped
+// ciphertext must therefore pass the Keyring owner's own old public key as
+// sPKBytes, not the original external sender's public key used everywhere
+// else -- a rewrapped label is attributable to the Keyring that rewrapped
+// it, not to whoever sealed the label originally. Callers that assume
+// sPKBytes always means "the matching system" (or "the DSP") will fail
+// Open/NewReceiver on a rewrapped ciphertext unless they account for this.
+package opjale
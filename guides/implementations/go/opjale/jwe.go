@@ -0,0 +1,460 @@
+package opjale
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudflare/circl/hpke"
+	"io"
+	"strings"
+)
+
+// jweHeader is the protected header carried by a JWE produced by this
+// package: the HPKE suite and AEAD algorithm names (RFC 7516 "alg"/"enc"),
+// the transaction id the caller passed as aad (custom "txn" claim, folded
+// into the header so it's part of what the header's encoding integrity-
+// protects instead of out-of-band AAD), and, for the Compact Serialization
+// only, the HPKE encapsulated key for that single recipient. The JSON
+// Serialization's shared protected header leaves Epk empty, since each
+// recipient's encapsulated key differs; it lives on that recipient's own
+// entry instead (see jweRecipientHeader).
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc,omitempty"`
+	Epk string `json:"epk,omitempty"`
+	Txn string `json:"txn,omitempty"`
+}
+
+// jweRecipientHeader is the per-recipient unprotected header of a JWE
+// JSON Serialization recipient entry (RFC 7516 §7.2.1): just the HPKE
+// encapsulated key for that recipient, since alg/enc/txn are shared and
+// live in the document's protected header.
+type jweRecipientHeader struct {
+	Epk string `json:"epk"`
+}
+
+// jweRecipient is one entry of a JWE JSON Serialization recipient array
+// (RFC 7516 §7.2.1): a per-recipient header plus the content encryption
+// key wrapped for that recipient. EncryptedKey is the base64url encoding
+// of that recipient's HPKE-derived AEAD sealing the shared CEK, framed as
+// nonce || ciphertext || tag with no length prefixes (see concatRaw).
+type jweRecipient struct {
+	Header       jweRecipientHeader `json:"header"`
+	EncryptedKey string             `json:"encrypted_key"`
+}
+
+// jweGeneralJSON is the JWE JSON Serialization (RFC 7516 §7.2) used for
+// sealing one label to several recipients at once. A single random
+// content encryption key (CEK) encrypts the label exactly once, shared by
+// every recipient (Protected/IV/Ciphertext/Tag); each recipient differs
+// only in how that CEK is wrapped (Recipients[i].EncryptedKey), using
+// that recipient's own HPKE-derived AEAD key in place of a key-wrapping
+// algorithm like RSA-OAEP.
+type jweGeneralJSON struct {
+	Protected  string         `json:"protected"`
+	IV         string         `json:"iv"`
+	Ciphertext string         `json:"ciphertext"`
+	Tag        string         `json:"tag"`
+	Recipients []jweRecipient `json:"recipients"`
+}
+
+// algName returns the JWE "alg" value identifying suite, e.g.
+// "HPKE-X25519-SHA256-A128GCM".
+func (suite LESuite) algName() string {
+	kemID, kdfID, aeadID := suite.l.Params()
+	return fmt.Sprintf("HPKE-%s-%s-%s", kemName(kemID), kdfHashName(kdfID), aeadName(aeadID))
+}
+
+func kemName(id hpke.KEM) string {
+	switch id {
+	case hpke.KEM_X25519_HKDF_SHA256:
+		return "X25519"
+	case hpke.KEM_X448_HKDF_SHA512:
+		return "X448"
+	case hpke.KEM_P256_HKDF_SHA256:
+		return "P256"
+	case hpke.KEM_P384_HKDF_SHA384:
+		return "P384"
+	case hpke.KEM_P521_HKDF_SHA512:
+		return "P521"
+	default:
+		return fmt.Sprintf("KEM%d", id)
+	}
+}
+
+func kdfHashName(id hpke.KDF) string {
+	switch id {
+	case hpke.KDF_HKDF_SHA256:
+		return "SHA256"
+	case hpke.KDF_HKDF_SHA384:
+		return "SHA384"
+	case hpke.KDF_HKDF_SHA512:
+		return "SHA512"
+	default:
+		return fmt.Sprintf("KDF%d", id)
+	}
+}
+
+func aeadName(id hpke.AEAD) string {
+	switch id {
+	case hpke.AEAD_AES128GCM:
+		return "A128GCM"
+	case hpke.AEAD_AES256GCM:
+		return "A256GCM"
+	case hpke.AEAD_ChaCha20Poly1305:
+		return "C20P"
+	default:
+		return fmt.Sprintf("AEAD%d", id)
+	}
+}
+
+// sealRaw behaves like seal, but returns the nonce, ciphertext, and
+// authentication tag separately and base64-free, as JWE requires them.
+func (s Sealer) sealRaw(pt, aad []byte) (nonce, ct, tag []byte, err error) {
+	s.mu.Lock()
+	nonce = append([]byte(nil), s.calcNonce()...)
+	err = s.increment()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	full := s.AEAD.Seal(nil, nonce, pt, aad)
+	overhead := s.AEAD.Overhead()
+	return nonce, full[:len(full)-overhead], full[len(full)-overhead:], nil
+}
+
+// sealJWE builds the protected header and ciphertext for the Compact
+// Serialization shared by SealOneJWE/SealZeroJWE. aad is folded into the
+// header's "txn" claim rather than combined out-of-band, so the AEAD's
+// AAD really is just ASCII(encoded protected header) per RFC 7516 §5.1
+// step 14 (a JWE AAD member, and the out-of-band AAD it would carry,
+// exist only in the JSON Serialization) -- required for the token to be
+// decryptable by generic JOSE tooling at all.
+func (s Sealer) sealJWE(pt []byte, aad string) (protectedB64 string, nonce, ct, tag []byte, err error) {
+	header := jweHeader{
+		Alg: s.suite.algName(),
+		Enc: aeadNameOf(s.suite),
+		Epk: base64.RawURLEncoding.EncodeToString(s.encapKey),
+		Txn: aad,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	protectedB64 = base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	nonce, ct, tag, err = s.sealRaw(pt, []byte(protectedB64))
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	return protectedB64, nonce, ct, tag, nil
+}
+
+func aeadNameOf(suite LESuite) string {
+	_, _, aeadID := suite.l.Params()
+	return aeadName(aeadID)
+}
+
+// SealOneJWE/SealZeroJWE share this compact serialization: the five
+// dot-separated segments protected.encrypted_key.iv.ciphertext.tag from
+// RFC 7516 §7.1. encrypted_key is left empty because the AEAD key comes
+// directly from the HPKE export, not from a wrapped CEK.
+func (s Sealer) sealCompact(pt []byte, aad string) (string, error) {
+	protectedB64, nonce, ct, tag, err := s.sealJWE(pt, aad)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		protectedB64,
+		"",
+		base64.RawURLEncoding.EncodeToString(nonce),
+		base64.RawURLEncoding.EncodeToString(ct),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// SealOneJWE encrypts "0xFF" for aad and returns it as a JWE Compact
+// Serialization string. The nonce is incremented after each call.
+func (s Sealer) SealOneJWE(aad string) (string, error) {
+	return s.sealCompact([]byte{labelOne}, aad)
+}
+
+// SealZeroJWE encrypts "0x00" for aad and returns it as a JWE Compact
+// Serialization string. The nonce is incremented after each call.
+func (s Sealer) SealZeroJWE(aad string) (string, error) {
+	return s.sealCompact([]byte{labelZero}, aad)
+}
+
+// SealManyJWE seals the same label ("0xFF" if one is true, else "0x00")
+// to every sealer in sealers — one per recipient's public key, each
+// produced by that recipient's own call to NewSender — and returns a
+// single JWE JSON Serialization object (RFC 7516 §7.2). Per the spec,
+// every recipient shares one content encryption (the label is encrypted
+// exactly once, under a CEK generated here); recipients differ only in
+// how that CEK is wrapped, each with its own HPKE-derived AEAD key taking
+// the place of a conventional key-wrapping algorithm like RSA-OAEP. All
+// sealers must share the same suite.
+func SealManyJWE(sealers []Sealer, one bool, aad string) (string, error) {
+	if len(sealers) == 0 {
+		return "", errors.New("no recipients given")
+	}
+	pt := []byte{labelZero}
+	if one {
+		pt = []byte{labelOne}
+	}
+
+	suite := sealers[0].suite
+	suiteID := suite.ID()
+	for _, s := range sealers {
+		if s.suite.ID() != suiteID {
+			return "", errors.New("all recipients must share the same suite")
+		}
+	}
+
+	header := jweHeader{
+		Alg: suite.algName(),
+		Enc: aeadNameOf(suite),
+		Txn: aad,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	_, _, aeadID := suite.l.Params()
+	cek := make([]byte, aeadID.KeySize())
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return "", err
+	}
+	cekAEAD, err := aeadID.New(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, cekAEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	full := cekAEAD.Seal(nil, iv, pt, []byte(protectedB64))
+	overhead := cekAEAD.Overhead()
+	ct, tag := full[:len(full)-overhead], full[len(full)-overhead:]
+
+	recipients := make([]jweRecipient, 0, len(sealers))
+	for _, s := range sealers {
+		nonce, wrappedCT, wrappedTag, err := s.sealRaw(cek, nil)
+		if err != nil {
+			return "", err
+		}
+		encryptedKey := concatRaw(nonce, wrappedCT, wrappedTag)
+
+		recipients = append(recipients, jweRecipient{
+			Header:       jweRecipientHeader{Epk: base64.RawURLEncoding.EncodeToString(s.encapKey)},
+			EncryptedKey: base64.RawURLEncoding.EncodeToString(encryptedKey),
+		})
+	}
+
+	doc, err := json.Marshal(jweGeneralJSON{
+		Protected:  protectedB64,
+		IV:         base64.RawURLEncoding.EncodeToString(iv),
+		Ciphertext: base64.RawURLEncoding.EncodeToString(ct),
+		Tag:        base64.RawURLEncoding.EncodeToString(tag),
+		Recipients: recipients,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(doc), nil
+}
+
+// concatRaw joins a nonce, ciphertext, and tag into the single
+// nonce||ciphertext||tag blob used for a JWE JSON Serialization
+// recipient's encrypted_key. unwrapCEK reverses it.
+func concatRaw(nonce, ct, tag []byte) []byte {
+	b := make([]byte, 0, len(nonce)+len(ct)+len(tag))
+	b = append(b, nonce...)
+	b = append(b, ct...)
+	b = append(b, tag...)
+	return b
+}
+
+// openRawAEAD opens an AEAD-sealed nonce/ciphertext/tag triple under o's
+// own HPKE-derived key, with no assumption about what the recovered
+// plaintext represents. openRaw and unwrapCEK build on it.
+func (o Opener) openRawAEAD(nonce, ct, tag, aad []byte) ([]byte, error) {
+	full := append(append([]byte(nil), ct...), tag...)
+	return o.AEAD.Open(nil, nonce, full, aad)
+}
+
+// openRaw behaves like Open, but takes the nonce, ciphertext, and
+// authentication tag separately instead of a single base64 blob.
+func (o Opener) openRaw(nonce, ct, tag, aad []byte) ([]byte, error) {
+	pt, err := o.openRawAEAD(nonce, ct, tag, aad)
+	if err != nil {
+		return nil, err
+	}
+	if !bytesEqualLabel(pt) {
+		return nil, errors.New("invalid label")
+	}
+	return pt, nil
+}
+
+// unwrapCEK recovers the content encryption key a JWE JSON Serialization
+// recipient entry wrapped for o, given that entry's encrypted_key decoded
+// back into its nonce || ciphertext || tag framing.
+func (o Opener) unwrapCEK(encryptedKey []byte) ([]byte, error) {
+	nonceLen := o.AEAD.NonceSize()
+	overhead := o.AEAD.Overhead()
+	if len(encryptedKey) < nonceLen+overhead {
+		return nil, errors.New("encrypted_key shorter than nonce plus aead overhead")
+	}
+	nonce := encryptedKey[:nonceLen]
+	rest := encryptedKey[nonceLen:]
+	ct, tag := rest[:len(rest)-overhead], rest[len(rest)-overhead:]
+	return o.openRawAEAD(nonce, ct, tag, nil)
+}
+
+func bytesEqualLabel(pt []byte) bool {
+	return len(pt) == 1 && (pt[0] == labelOne || pt[0] == labelZero)
+}
+
+// verifyJWEHeader checks that a parsed header names the suite o was
+// constructed with, so a ciphertext sealed under one negotiated suite
+// can't silently be opened as if it were sealed under another.
+func (o Opener) verifyJWEHeader(header jweHeader) error {
+	if header.Alg != o.suite.algName() {
+		return fmt.Errorf("jwe alg %q does not match suite %q", header.Alg, o.suite.algName())
+	}
+	if header.Enc != "" && header.Enc != aeadNameOf(o.suite) {
+		return fmt.Errorf("jwe enc %q does not match suite %q", header.Enc, aeadNameOf(o.suite))
+	}
+	return nil
+}
+
+// OpenJWE recovers the plaintext label from a JWE produced by
+// SealOneJWE/SealZeroJWE/SealManyJWE, accepting either the Compact or
+// JSON Serialization. It rejects ciphertexts whose header names a suite
+// other than the one o was constructed with.
+func (o Opener) OpenJWE(token, aad string) ([]byte, error) {
+	trimmed := strings.TrimSpace(token)
+	if strings.HasPrefix(trimmed, "{") {
+		return o.openJWEJSON(trimmed, aad)
+	}
+	return o.openJWECompact(trimmed, aad)
+}
+
+func (o Opener) openJWECompact(token, aad string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, errors.New("jwe compact serialization must have 5 segments")
+	}
+	protectedB64, _, ivB64, ctB64, tagB64 := parts[0], parts[1], parts[2], parts[3], parts[4]
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(protectedB64)
+	if err != nil {
+		return nil, err
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, err
+	}
+	if err := o.verifyJWEHeader(header); err != nil {
+		return nil, err
+	}
+	if header.Txn != aad {
+		return nil, errors.New("jwe txn claim does not match aad")
+	}
+
+	nonce, err := base64.RawURLEncoding.DecodeString(ivB64)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := base64.RawURLEncoding.DecodeString(ctB64)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(tagB64)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.openRaw(nonce, ct, tag, []byte(protectedB64))
+}
+
+// openJWEJSON handles the JWE JSON Serialization produced by
+// SealManyJWE: it finds the recipient entry whose encapsulated key
+// matches o's, unwraps the shared content encryption key from it, and
+// uses that key to open the one ciphertext shared by every recipient.
+func (o Opener) openJWEJSON(token, aad string) ([]byte, error) {
+	var doc jweGeneralJSON
+	if err := json.Unmarshal([]byte(token), &doc); err != nil {
+		return nil, err
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(doc.Protected)
+	if err != nil {
+		return nil, err
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, err
+	}
+	if err := o.verifyJWEHeader(header); err != nil {
+		return nil, err
+	}
+	if header.Txn != aad {
+		return nil, errors.New("jwe txn claim does not match aad")
+	}
+
+	ownEpk := base64.RawURLEncoding.EncodeToString(o.encapKey)
+	var encryptedKeyB64 string
+	found := false
+	for _, recipient := range doc.Recipients {
+		if recipient.Header.Epk == ownEpk {
+			encryptedKeyB64 = recipient.EncryptedKey
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("no recipient entry matches this opener's encapsulated key")
+	}
+
+	encryptedKey, err := base64.RawURLEncoding.DecodeString(encryptedKeyB64)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := o.unwrapCEK(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := base64.RawURLEncoding.DecodeString(doc.IV)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := base64.RawURLEncoding.DecodeString(doc.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(doc.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, aeadID := o.suite.l.Params()
+	cekAEAD, err := aeadID.New(cek)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := cekAEAD.Open(nil, iv, append(append([]byte(nil), ct...), tag...), []byte(doc.Protected))
+	if err != nil {
+		return nil, err
+	}
+	if !bytesEqualLabel(pt) {
+		return nil, errors.New("invalid label")
+	}
+	return pt, nil
+}
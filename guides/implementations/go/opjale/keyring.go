@@ -0,0 +1,242 @@
+package opjale
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// keyringKeyPair is one versioned key pair held by a Keyring.
+type keyringKeyPair struct {
+	pk, sk []byte
+}
+
+// Keyring holds an ordered set of versioned key pairs for one party,
+// modeled on Vault's transit backend: Rotate() mints a new version
+// without discarding the ones still needed to decrypt in-flight
+// transactions, so DSP and matching-system keys can be rotated without
+// breaking label encryption/decryption that's already underway.
+type Keyring struct {
+	mu       sync.RWMutex
+	suite    LESuite
+	versions map[uint32]keyringKeyPair
+	current  uint32
+
+	// MinDecryptVersion is the oldest key version Get (and therefore
+	// KeyringReceiver) will still use to decrypt; versions older than it
+	// are pruned on the next Rotate. Zero means no floor.
+	//
+	// Rotate never prunes the version it just minted even if
+	// MinDecryptVersion was set above it, since that would leave Current
+	// returning version 0 and nil keys right after a successful rotation.
+	// Like MaxRetainedVersions, it's a plain field rather than a
+	// lock-guarded setter: set it before sharing the Keyring across
+	// goroutines, or only from the same goroutine that owns rotation
+	// policy, since reading it (Get/prune) is synchronized but writing it
+	// is not.
+	MinDecryptVersion uint32
+	// MaxRetainedVersions caps how many of the most recent versions are
+	// kept; versions older than Current()-MaxRetainedVersions+1 are
+	// pruned on the next Rotate. Zero means every version is retained.
+	// See MinDecryptVersion's comment on concurrent writes.
+	MaxRetainedVersions uint32
+}
+
+// NewKeyring returns an empty Keyring for suite; call Rotate at least
+// once before Current/NewKeyringSender/NewKeyringReceiver are useful.
+func NewKeyring(suite LESuite) *Keyring {
+	return &Keyring{suite: suite, versions: make(map[uint32]keyringKeyPair)}
+}
+
+// Suite returns the LESuite new key pairs are generated under.
+func (kr *Keyring) Suite() LESuite {
+	return kr.suite
+}
+
+// Rotate generates a new key pair, retains it as the next version, and
+// returns that version number. Rotate can safely run concurrently with
+// Get and with KeyringReceiver.NewReceiver calls already in flight
+// against an older version.
+func (kr *Keyring) Rotate() (version uint32, err error) {
+	pk, sk, err := kr.suite.GenerateKeyPair()
+	if err != nil {
+		return 0, err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.current++
+	kr.versions[kr.current] = keyringKeyPair{pk, sk}
+	kr.prune()
+	return kr.current, nil
+}
+
+// Current returns the most recently rotated version and its key pair. It
+// returns version 0 and nil keys if Rotate has never been called.
+func (kr *Keyring) Current() (version uint32, pk, sk []byte) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	entry, ok := kr.versions[kr.current]
+	if !ok {
+		return 0, nil, nil
+	}
+	return kr.current, entry.pk, entry.sk
+}
+
+// Get returns the key pair for version, or ok=false if that version was
+// never rotated or has since been pruned by MinDecryptVersion or
+// MaxRetainedVersions.
+func (kr *Keyring) Get(version uint32) (pk, sk []byte, ok bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if version < kr.MinDecryptVersion {
+		return nil, nil, false
+	}
+	entry, ok := kr.versions[version]
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.pk, entry.sk, true
+}
+
+// prune drops any retained version older than MinDecryptVersion or older
+// than the MaxRetainedVersions most recent versions, but never the
+// version Rotate just minted: if MinDecryptVersion was set above
+// kr.current, the version just rotated to is kept anyway so Current
+// keeps returning its key pair right after a rotation. Callers must hold
+// kr.mu for writing.
+func (kr *Keyring) prune() {
+	oldestAllowed := kr.MinDecryptVersion
+	if oldestAllowed > kr.current {
+		oldestAllowed = kr.current
+	}
+	if kr.MaxRetainedVersions != 0 && kr.current > kr.MaxRetainedVersions {
+		if floor := kr.current - kr.MaxRetainedVersions + 1; floor > oldestAllowed {
+			oldestAllowed = floor
+		}
+	}
+	for v := range kr.versions {
+		if v < oldestAllowed {
+			delete(kr.versions, v)
+		}
+	}
+}
+
+// KeyringSender seals labels to a single recipient key version instead
+// of a bare public key, tagging the encapsulated key with that version
+// so the recipient's KeyringReceiver can find the matching historical
+// private key even after rotating past it.
+type KeyringSender struct {
+	suite LESuite
+}
+
+// NewKeyringSender returns a KeyringSender that seals under suite.
+func NewKeyringSender(suite LESuite) KeyringSender {
+	return KeyringSender{suite: suite}
+}
+
+// NewSender behaves like LESuite.NewSender, sealing to rPKBytes (the
+// recipient's key pair at rVersion) and authenticating with sSKBytes,
+// except the returned encapsulated key is prefixed with a 4-byte
+// big-endian rVersion for KeyringReceiver.NewReceiver to consume.
+func (ks KeyringSender) NewSender(sSKBytes []byte, rVersion uint32, rPKBytes, info []byte) ([]byte, Sealer, error) {
+	encapKey, sealer, err := ks.suite.NewSender(sSKBytes, rPKBytes, info)
+	if err != nil {
+		return nil, Sealer{}, err
+	}
+
+	versioned := make([]byte, 4, 4+len(encapKey))
+	binary.BigEndian.PutUint32(versioned, rVersion)
+	return append(versioned, encapKey...), sealer, nil
+}
+
+// KeyringReceiver opens ciphertexts sealed by a KeyringSender, resolving
+// the recipient private key version embedded in the encapsulated key
+// against a Keyring automatically instead of requiring the caller to
+// track which key version was current when the label was sealed.
+type KeyringReceiver struct {
+	keyring *Keyring
+}
+
+// NewKeyringReceiver returns a KeyringReceiver backed by kr.
+func NewKeyringReceiver(kr *Keyring) KeyringReceiver {
+	return KeyringReceiver{keyring: kr}
+}
+
+// NewReceiver strips the 4-byte key-version prefix added by
+// KeyringSender.NewSender, looks up the matching historical key pair in
+// kro's Keyring, and returns an Opener for it.
+func (kro KeyringReceiver) NewReceiver(sPKBytes, info, versionedEncapKey []byte) (Opener, error) {
+	version, encapKey, err := keyVersionFromBytes(versionedEncapKey)
+	if err != nil {
+		return Opener{}, err
+	}
+
+	_, rSK, ok := kro.keyring.Get(version)
+	if !ok {
+		return Opener{}, fmt.Errorf("keyring has no retained key for version %d", version)
+	}
+
+	return kro.keyring.suite.NewReceiver(sPKBytes, rSK, info, encapKey)
+}
+
+// keyVersionFromBytes reads the 4-byte big-endian key-version prefix off
+// the front of b, returning it along with the remaining bytes.
+func keyVersionFromBytes(b []byte) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errors.New("encapsulated key missing keyring version prefix")
+	}
+	return binary.BigEndian.Uint32(b[0:4]), b[4:], nil
+}
+
+// Rewrap migrates a label sealed to the key version embedded in
+// oldEncapKey over to newVersion without exposing the recovered
+// plaintext to the caller: it opens oldCT with the matching historical
+// key (authenticating the original sender via sPKBytes), then reseals
+// the recovered label under kr's key at newVersion, authenticating the
+// new ciphertext with kr's own key at the old version.
+func (kr *Keyring) Rewrap(sPKBytes, info, oldEncapKey []byte, oldCT, aad string, newVersion uint32) (newEncapKey []byte, newCT string, err error) {
+	oldVersion, _, err := keyVersionFromBytes(oldEncapKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	opener, err := NewKeyringReceiver(kr).NewReceiver(sPKBytes, info, oldEncapKey)
+	if err != nil {
+		return nil, "", err
+	}
+	pt, err := opener.Open(oldCT, aad)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, oldSK, ok := kr.Get(oldVersion)
+	if !ok {
+		return nil, "", fmt.Errorf("keyring has no retained key for version %d to authenticate rewrap", oldVersion)
+	}
+	newPK, _, ok := kr.Get(newVersion)
+	if !ok {
+		return nil, "", fmt.Errorf("keyring has no key for version %d", newVersion)
+	}
+
+	newEncapKey, sealer, err := NewKeyringSender(kr.suite).NewSender(oldSK, newVersion, newPK, info)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.Equal(pt, []byte{labelOne}):
+		newCT, err = sealer.SealOne(aad)
+	case bytes.Equal(pt, []byte{labelZero}):
+		newCT, err = sealer.SealZero(aad)
+	default:
+		return nil, "", errors.New("invalid label")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return newEncapKey, newCT, nil
+}
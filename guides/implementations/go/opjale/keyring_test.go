@@ -0,0 +1,213 @@
+package opjale
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestKeyringRotateAndGet(t *testing.T) {
+	kr := NewKeyring(NewLESuite())
+
+	v1, err := kr.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+	if v1 != 1 {
+		t.Fatalf("first rotation should be version 1, got %d", v1)
+	}
+
+	v2, err := kr.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+	if v2 != 2 {
+		t.Fatalf("second rotation should be version 2, got %d", v2)
+	}
+
+	curVersion, curPK, _ := kr.Current()
+	if curVersion != v2 {
+		t.Errorf("Current version = %d, want %d", curVersion, v2)
+	}
+
+	if _, _, ok := kr.Get(v1); !ok {
+		t.Error("Get could not find the first rotated version")
+	}
+	if pk, _, ok := kr.Get(v2); !ok || !bytes.Equal(pk, curPK) {
+		t.Error("Get did not return the current version's key pair")
+	}
+	if _, _, ok := kr.Get(99); ok {
+		t.Error("Get returned ok for a version that was never rotated")
+	}
+}
+
+func TestKeyringMaxRetainedVersions(t *testing.T) {
+	kr := NewKeyring(NewLESuite())
+	kr.MaxRetainedVersions = 2
+
+	var last uint32
+	for i := 0; i < 3; i++ {
+		v, err := kr.Rotate()
+		if err != nil {
+			t.Fatalf("Rotate failed: %s", err)
+		}
+		last = v
+	}
+
+	if _, _, ok := kr.Get(1); ok {
+		t.Error("Get found a version that should have been pruned by MaxRetainedVersions")
+	}
+	if _, _, ok := kr.Get(last - 1); !ok {
+		t.Error("Get could not find a version that should still be retained")
+	}
+	if _, _, ok := kr.Get(last); !ok {
+		t.Error("Get could not find the current version")
+	}
+}
+
+func TestKeyringRotateDoesNotPruneJustMintedVersion(t *testing.T) {
+	kr := NewKeyring(NewLESuite())
+	kr.MinDecryptVersion = 5
+
+	v, err := kr.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+	if v != 1 {
+		t.Fatalf("first rotation should be version 1, got %d", v)
+	}
+
+	curVersion, pk, sk := kr.Current()
+	if curVersion != v || pk == nil || sk == nil {
+		t.Fatalf("Current() = (%d, %v, %v), want the version just rotated to with its key pair (MinDecryptVersion should not prune it)", curVersion, pk, sk)
+	}
+}
+
+func TestKeyringConcurrentRotateAndGet(t *testing.T) {
+	kr := NewKeyring(NewLESuite())
+	if _, err := kr.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := kr.Rotate(); err != nil {
+				t.Errorf("Rotate failed: %s", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			kr.Get(1)
+			kr.Current()
+		}
+	}()
+	wg.Wait()
+}
+
+func TestKeyringSenderReceiverRoundTrip(t *testing.T) {
+	suite := NewLESuite()
+	msPK, msSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	dspKeyring := NewKeyring(suite)
+	oldVersion, err := dspKeyring.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+	_, err = dspKeyring.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+
+	info := []byte("matching-system.example")
+	aad := "2VwhmTY9MecgWsu6"
+
+	oldPK, _, ok := dspKeyring.Get(oldVersion)
+	if !ok {
+		t.Fatal("could not fetch the old DSP key version")
+	}
+
+	encapKey, sealer, err := NewKeyringSender(suite).NewSender(msSK, oldVersion, oldPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+	ct, err := sealer.SealOne(aad)
+	if err != nil {
+		t.Fatalf("SealOne failed: %s", err)
+	}
+
+	opener, err := NewKeyringReceiver(dspKeyring).NewReceiver(msPK, info, encapKey)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %s", err)
+	}
+	pt, err := opener.Open(ct, aad)
+	if err != nil {
+		t.Fatalf("Open failed: %s", err)
+	}
+	if !bytes.Equal(pt, []byte{labelOne}) {
+		t.Fatal("plaintext mismatch")
+	}
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	suite := NewLESuite()
+	msPK, msSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	dspKeyring := NewKeyring(suite)
+	oldVersion, err := dspKeyring.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+	newVersion, err := dspKeyring.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %s", err)
+	}
+
+	info := []byte("matching-system.example")
+	aad := "2VwhmTY9MecgWsu6"
+
+	oldPK, _, ok := dspKeyring.Get(oldVersion)
+	if !ok {
+		t.Fatal("could not fetch the old DSP key version")
+	}
+	encapKey, sealer, err := NewKeyringSender(suite).NewSender(msSK, oldVersion, oldPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+	oldCT, err := sealer.SealZero(aad)
+	if err != nil {
+		t.Fatalf("SealZero failed: %s", err)
+	}
+
+	newEncapKey, newCT, err := dspKeyring.Rewrap(msPK, info, encapKey, oldCT, aad, newVersion)
+	if err != nil {
+		t.Fatalf("Rewrap failed: %s", err)
+	}
+
+	selfPK, _, ok := dspKeyring.Get(oldVersion)
+	if !ok {
+		t.Fatal("could not fetch the rewrap's authenticating key version")
+	}
+	opener, err := NewKeyringReceiver(dspKeyring).NewReceiver(selfPK, info, newEncapKey)
+	if err != nil {
+		t.Fatalf("NewReceiver for rewrapped ciphertext failed: %s", err)
+	}
+	pt, err := opener.Open(newCT, aad)
+	if err != nil {
+		t.Fatalf("Open for rewrapped ciphertext failed: %s", err)
+	}
+	if !bytes.Equal(pt, []byte{labelZero}) {
+		t.Fatal("plaintext mismatch after rewrap")
+	}
+}
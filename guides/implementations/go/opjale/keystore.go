@@ -0,0 +1,179 @@
+package opjale
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/pbkdf2"
+	"io"
+	"os"
+)
+
+// DefaultPBKDF2Iterations is the PBKDF2 iteration count ExportPrivateKey
+// uses unless the caller picks a different one with
+// ExportPrivateKeyWithIterations.
+const DefaultPBKDF2Iterations = 600_000
+
+const (
+	privateKeyBlobMagic   = "OPJK"
+	privateKeyBlobVersion = 1
+	privateKeySaltSize    = 16
+	privateKeyNonceSize   = 24
+	secretboxKeySize      = 32
+
+	privateKeyHeaderSize = len(privateKeyBlobMagic) + 1 + 4 + privateKeySaltSize + privateKeyNonceSize
+)
+
+// ExportPrivateKey wraps sk for long-term storage: it derives a 32-byte
+// key from passphrase with PBKDF2-HMAC-SHA256 (DefaultPBKDF2Iterations
+// iterations) and encrypts sk with NaCl secretbox (XSalsa20-Poly1305)
+// under a fresh random nonce. The returned blob is self-describing:
+// [magic(4) | version(1) | kdf_iters(4) | salt(16) | nonce(24) | ciphertext].
+func (suite LESuite) ExportPrivateKey(sk, passphrase []byte) ([]byte, error) {
+	return suite.ExportPrivateKeyWithIterations(sk, passphrase, DefaultPBKDF2Iterations)
+}
+
+// ExportPrivateKeyWithIterations behaves like ExportPrivateKey but lets
+// the caller choose the PBKDF2 iteration count instead of
+// DefaultPBKDF2Iterations.
+func (suite LESuite) ExportPrivateKeyWithIterations(sk, passphrase []byte, iterations int) ([]byte, error) {
+	if iterations < 1 {
+		return nil, errors.New("kdf iterations must be positive")
+	}
+
+	salt := make([]byte, privateKeySaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	var key [secretboxKeySize]byte
+	copy(key[:], pbkdf2.Key(passphrase, salt, iterations, secretboxKeySize, sha256.New))
+
+	var nonce [privateKeyNonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, 0, privateKeyHeaderSize)
+	blob = append(blob, []byte(privateKeyBlobMagic)...)
+	blob = append(blob, privateKeyBlobVersion)
+	itersBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(itersBytes, uint32(iterations))
+	blob = append(blob, itersBytes...)
+	blob = append(blob, salt...)
+	blob = append(blob, nonce[:]...)
+
+	return secretbox.Seal(blob, sk, &nonce, &key), nil
+}
+
+// ImportPrivateKey reverses ExportPrivateKey/ExportPrivateKeyWithIterations,
+// recovering the marshalled private key from blob given the same
+// passphrase it was exported with.
+func ImportPrivateKey(blob, passphrase []byte) ([]byte, error) {
+	if len(blob) < privateKeyHeaderSize {
+		return nil, errors.New("private key blob truncated")
+	}
+	if string(blob[0:4]) != privateKeyBlobMagic {
+		return nil, errors.New("not an opjale private key blob")
+	}
+	if version := blob[4]; version != privateKeyBlobVersion {
+		return nil, fmt.Errorf("unsupported private key blob version %d", version)
+	}
+
+	iterations := binary.BigEndian.Uint32(blob[5:9])
+	salt := blob[9 : 9+privateKeySaltSize]
+	var nonce [privateKeyNonceSize]byte
+	copy(nonce[:], blob[9+privateKeySaltSize:privateKeyHeaderSize])
+	ciphertext := blob[privateKeyHeaderSize:]
+
+	var key [secretboxKeySize]byte
+	copy(key[:], pbkdf2.Key(passphrase, salt, int(iterations), secretboxKeySize, sha256.New))
+
+	sk, ok := secretbox.Open(nil, ciphertext, &nonce, &key)
+	if !ok {
+		return nil, errors.New("failed to decrypt private key: wrong passphrase or corrupt blob")
+	}
+	return sk, nil
+}
+
+const (
+	publicKeyBlobMagic   = "OPJP"
+	publicKeyBlobVersion = 1
+	publicKeyHeaderSize  = len(publicKeyBlobMagic) + 1
+)
+
+// ExportPublicKey wraps pk (as returned by GenerateKeyPair, already
+// tagged with suite's KEM id) in a small versioned, self-describing
+// header. Unlike private keys, public keys are not encrypted.
+func (suite LESuite) ExportPublicKey(pk []byte) ([]byte, error) {
+	if _, err := suite.stripKEMTag(pk); err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, 0, publicKeyHeaderSize+len(pk))
+	blob = append(blob, []byte(publicKeyBlobMagic)...)
+	blob = append(blob, publicKeyBlobVersion)
+	return append(blob, pk...), nil
+}
+
+// ImportPublicKey reverses ExportPublicKey, recovering the KEM-tagged
+// public key bytes expected by NewSender/NewReceiver.
+func ImportPublicKey(blob []byte) ([]byte, error) {
+	if len(blob) < publicKeyHeaderSize {
+		return nil, errors.New("public key blob truncated")
+	}
+	if string(blob[0:4]) != publicKeyBlobMagic {
+		return nil, errors.New("not an opjale public key blob")
+	}
+	if version := blob[4]; version != publicKeyBlobVersion {
+		return nil, fmt.Errorf("unsupported public key blob version %d", version)
+	}
+	return blob[publicKeyHeaderSize:], nil
+}
+
+// SaveKeyPairToFile writes pk and sk to path+".pub" and path
+// respectively, encrypting the private key with passphrase via
+// ExportPrivateKey. The private key file is created with permissions
+// restricted to the owner.
+func SaveKeyPairToFile(suite LESuite, pk, sk, passphrase []byte, path string) error {
+	privBlob, err := suite.ExportPrivateKey(sk, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, privBlob, 0o600); err != nil {
+		return err
+	}
+
+	pubBlob, err := suite.ExportPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".pub", pubBlob, 0o644)
+}
+
+// LoadKeyPairFromFile reverses SaveKeyPairToFile, reading the private key
+// from path and the public key from path+".pub".
+func LoadKeyPairFromFile(suite LESuite, path string, passphrase []byte) (pk, sk []byte, err error) {
+	privBlob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sk, err = ImportPrivateKey(privBlob, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubBlob, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err = ImportPublicKey(pubBlob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pk, sk, nil
+}
@@ -0,0 +1,87 @@
+package opjale
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportPrivateKeyRoundTrip(t *testing.T) {
+	suite := NewLESuite()
+	_, sk, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	passphrase := []byte("correct horse battery staple")
+
+	blob, err := suite.ExportPrivateKeyWithIterations(sk, passphrase, 1024)
+	if err != nil {
+		t.Fatalf("ExportPrivateKey failed: %s", err)
+	}
+
+	got, err := ImportPrivateKey(blob, passphrase)
+	if err != nil {
+		t.Fatalf("ImportPrivateKey failed: %s", err)
+	}
+	if !bytes.Equal(got, sk) {
+		t.Fatal("recovered private key does not match the original")
+	}
+
+	if _, err := ImportPrivateKey(blob, []byte("wrong passphrase")); err == nil {
+		t.Error("ImportPrivateKey succeeded with the wrong passphrase")
+	}
+}
+
+func TestExportImportPublicKeyRoundTrip(t *testing.T) {
+	suite := NewLESuite()
+	pk, _, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	blob, err := suite.ExportPublicKey(pk)
+	if err != nil {
+		t.Fatalf("ExportPublicKey failed: %s", err)
+	}
+
+	got, err := ImportPublicKey(blob)
+	if err != nil {
+		t.Fatalf("ImportPublicKey failed: %s", err)
+	}
+	if !bytes.Equal(got, pk) {
+		t.Fatal("recovered public key does not match the original")
+	}
+}
+
+func TestSaveLoadKeyPairToFile(t *testing.T) {
+	suite := NewLESuite()
+	pk, sk, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	passphrase := []byte("correct horse battery staple")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dsp.key")
+	if err := SaveKeyPairToFile(suite, pk, sk, passphrase, path); err != nil {
+		t.Fatalf("SaveKeyPairToFile failed: %s", err)
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatalf("private key file missing: %s", err)
+	} else if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("private key file has permissions %o, want 0600", perm)
+	}
+
+	gotPK, gotSK, err := LoadKeyPairFromFile(suite, path, passphrase)
+	if err != nil {
+		t.Fatalf("LoadKeyPairFromFile failed: %s", err)
+	}
+	if !bytes.Equal(gotPK, pk) {
+		t.Error("recovered public key does not match the original")
+	}
+	if !bytes.Equal(gotSK, sk) {
+		t.Error("recovered private key does not match the original")
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"github.com/cloudflare/circl/hpke"
 	"io"
+	"sync"
 )
 
 const (
@@ -20,12 +22,77 @@ type LESuite struct {
 	l hpke.Suite
 }
 
-// returns a label encryption suite with the specified KEM, KDF, and AEAD algorithms
+// SuiteID is a compact, self-describing encoding of the KEM, KDF, and AEAD
+// algorithm identifiers that make up an LESuite: three big-endian uint16
+// fields, in that order, in the style of the HPKE ciphersuite identifier
+// from RFC 9180 §7.1.
+type SuiteID [6]byte
+
+// Bytes returns the wire encoding of id.
+func (id SuiteID) Bytes() []byte {
+	b := make([]byte, len(id))
+	copy(b, id[:])
+	return b
+}
+
+// suiteIDFromBytes reads a SuiteID off the front of b, returning it along
+// with the remaining bytes.
+func suiteIDFromBytes(b []byte) (SuiteID, []byte, error) {
+	var id SuiteID
+	if len(b) < len(id) {
+		return id, nil, errors.New("suite id truncated")
+	}
+	copy(id[:], b[:len(id)])
+	return id, b[len(id):], nil
+}
+
+// ID returns the SuiteID identifying suite's KEM, KDF, and AEAD.
+func (suite LESuite) ID() SuiteID {
+	kemID, kdfID, aeadID := suite.l.Params()
+	var id SuiteID
+	binary.BigEndian.PutUint16(id[0:2], uint16(kemID))
+	binary.BigEndian.PutUint16(id[2:4], uint16(kdfID))
+	binary.BigEndian.PutUint16(id[4:6], uint16(aeadID))
+	return id
+}
+
+// returns a label encryption suite with the default KEM, KDF, and AEAD
+// algorithms: KEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, AEAD_AES128GCM
 func NewLESuite() LESuite {
-	return LESuite{l: hpke.NewSuite(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)}
+	return NewLESuiteWithParams(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+}
+
+// returns a label encryption suite built from any CIRCL-supported
+// combination of KEM, KDF, and AEAD algorithms, letting callers negotiate
+// a suite instead of relying on the default
+func NewLESuiteWithParams(kem hpke.KEM, kdf hpke.KDF, aead hpke.AEAD) LESuite {
+	return LESuite{l: hpke.NewSuite(kem, kdf, aead)}
+}
+
+// NegotiateSuite returns the LESuite for the first SuiteID in offered that
+// also appears in supported, preserving offered's preference order. It
+// returns an error if offered and supported have no suite in common.
+func NegotiateSuite(offered []SuiteID, supported []SuiteID) (LESuite, error) {
+	supportedSet := make(map[SuiteID]bool, len(supported))
+	for _, id := range supported {
+		supportedSet[id] = true
+	}
+
+	for _, id := range offered {
+		if !supportedSet[id] {
+			continue
+		}
+		kemID := hpke.KEM(binary.BigEndian.Uint16(id[0:2]))
+		kdfID := hpke.KDF(binary.BigEndian.Uint16(id[2:4]))
+		aeadID := hpke.AEAD(binary.BigEndian.Uint16(id[4:6]))
+		return NewLESuiteWithParams(kemID, kdfID, aeadID), nil
+	}
+	return LESuite{}, errors.New("no suite in common between offered and supported")
 }
 
-// wrapper for HPKE KEM GenerateKeyPair()
+// wrapper for HPKE KEM GenerateKeyPair() that tags the returned keys with
+// suite's KEM id so NewSender/NewReceiver can be called without the caller
+// separately tracking which suite a key pair belongs to
 func (suite LESuite) GenerateKeyPair() ([]byte, []byte, error) {
 	kemID, _, _ := suite.l.Params()
 	pk, sk, err := kemID.Scheme().GenerateKeyPair()
@@ -43,18 +110,42 @@ func (suite LESuite) GenerateKeyPair() ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	return pkBytes, skBytes, nil
+	kemTag := make([]byte, 2)
+	binary.BigEndian.PutUint16(kemTag, uint16(kemID))
+
+	return append(kemTag, pkBytes...), append(kemTag, skBytes...), nil
+}
+
+// stripKEMTag removes and validates the 2-byte KEM tag prepended by
+// GenerateKeyPair, returning the raw marshalled key bytes.
+func (suite LESuite) stripKEMTag(tagged []byte) ([]byte, error) {
+	kemID, _, _ := suite.l.Params()
+	if len(tagged) < 2 {
+		return nil, errors.New("key missing kem tag")
+	}
+	if hpke.KEM(binary.BigEndian.Uint16(tagged[0:2])) != kemID {
+		return nil, errors.New("key was generated for a different kem")
+	}
+	return tagged[2:], nil
 }
 
 // returns the encapsulated key and a Sealer (defined below) object for the specified aead algorithm
 func (suite LESuite) NewSender(sSKBytes, rPKBytes, info []byte) ([]byte, Sealer, error) {
 	kemID, _, aeadID := suite.l.Params()
-	rPK, err := kemID.Scheme().UnmarshalBinaryPublicKey(rPKBytes)
+	rPKRaw, err := suite.stripKEMTag(rPKBytes)
+	if err != nil {
+		return nil, Sealer{}, err
+	}
+	rPK, err := kemID.Scheme().UnmarshalBinaryPublicKey(rPKRaw)
 	if err != nil {
 		return nil, Sealer{}, err
 	}
 
-	sSK, err := kemID.Scheme().UnmarshalBinaryPrivateKey(sSKBytes)
+	sSKRaw, err := suite.stripKEMTag(sSKBytes)
+	if err != nil {
+		return nil, Sealer{}, err
+	}
+	sSK, err := kemID.Scheme().UnmarshalBinaryPrivateKey(sSKRaw)
 	if err != nil {
 		return nil, Sealer{}, err
 	}
@@ -81,24 +172,47 @@ func (suite LESuite) NewSender(sSKBytes, rPKBytes, info []byte) ([]byte, Sealer,
 		return nil, Sealer{}, err
 	}
 
-	return encapKey,
+	taggedEncapKey := append(suite.ID().Bytes(), encapKey...)
+	return taggedEncapKey,
 		Sealer{
 			aead,
 			baseNonce,
 			make([]byte, Nn),
 			make([]byte, Nn),
+			suite,
+			taggedEncapKey,
+			&sync.Mutex{},
 		}, nil
 }
 
-// returns an Opener (defined below) object for the specified aead algorithm
+// returns an Opener (defined below) object for the specified aead algorithm.
+// The encapKey must carry the SuiteID produced by NewSender; NewReceiver
+// refuses to proceed if it names a different suite than suite.
 func (suite LESuite) NewReceiver(sPKBytes, rSKBytes, info, encapKey []byte) (Opener, error) {
 	kemID, _, aeadID := suite.l.Params()
-	sPK, err := kemID.Scheme().UnmarshalBinaryPublicKey(sPKBytes)
+
+	gotID, rawEncapKey, err := suiteIDFromBytes(encapKey)
 	if err != nil {
 		return Opener{}, err
 	}
+	if gotID != suite.ID() {
+		return Opener{}, errors.New("encapsulated key was sealed with a different suite")
+	}
 
-	rSK, err := kemID.Scheme().UnmarshalBinaryPrivateKey(rSKBytes)
+	sPKRaw, err := suite.stripKEMTag(sPKBytes)
+	if err != nil {
+		return Opener{}, err
+	}
+	sPK, err := kemID.Scheme().UnmarshalBinaryPublicKey(sPKRaw)
+	if err != nil {
+		return Opener{}, err
+	}
+
+	rSKRaw, err := suite.stripKEMTag(rSKBytes)
+	if err != nil {
+		return Opener{}, err
+	}
+	rSK, err := kemID.Scheme().UnmarshalBinaryPrivateKey(rSKRaw)
 	if err != nil {
 		return Opener{}, err
 	}
@@ -108,7 +222,7 @@ func (suite LESuite) NewReceiver(sPKBytes, rSKBytes, info, encapKey []byte) (Ope
 		return Opener{}, err
 	}
 
-	opener, err := receiver.SetupAuth(encapKey, sPK)
+	opener, err := receiver.SetupAuth(rawEncapKey, sPK)
 	if err != nil {
 		return Opener{}, err
 	}
@@ -122,6 +236,8 @@ func (suite LESuite) NewReceiver(sPKBytes, rSKBytes, info, encapKey []byte) (Ope
 
 	return Opener{
 		aead,
+		suite,
+		encapKey,
 	}, nil
 }
 
@@ -131,9 +247,22 @@ type Sealer struct {
 	baseNonce      []byte
 	sequenceNumber []byte
 	nonce          []byte
+	suite          LESuite
+	encapKey       []byte
+
+	// mu guards sequenceNumber and nonce against concurrent readers and
+	// writers; every sealing path (seal, sealRaw, SealBatch) reserves its
+	// nonce(s) while holding it. It's a pointer so every Sealer value
+	// copied from the one NewSender returns (seal/SealOne/SealZero/
+	// SealBatch all take a value receiver) shares the same lock, the same
+	// way they already share baseNonce's backing array.
+	mu *sync.Mutex
 }
 
-// calculates nonce by XORing the base nonce with the sequence number
+// calculates nonce by XORing the base nonce with the sequence number.
+// Callers sharing a Sealer across goroutines must hold s.mu, since
+// s.nonce and s.sequenceNumber are backing arrays shared across every
+// copy of this Sealer value.
 func (s Sealer) calcNonce() []byte {
 	for i := range s.baseNonce {
 		s.nonce[i] = s.baseNonce[i] ^ s.sequenceNumber[i]
@@ -141,7 +270,8 @@ func (s Sealer) calcNonce() []byte {
 	return s.nonce
 }
 
-// increments sequence number
+// increments sequence number. Callers sharing a Sealer across goroutines
+// must hold s.mu; see calcNonce.
 func (s Sealer) increment() error {
 	allOnes := byte(0xFF)
 	for i := range s.sequenceNumber {
@@ -165,16 +295,15 @@ func (s Sealer) increment() error {
 
 // takes plaintext and associated data to produce a ciphertext. The nonce is incremented after each call.
 func (s Sealer) seal(pt, aad []byte) (string, error) {
-	nonce := s.calcNonce()
-	ct := s.AEAD.Seal(nil, nonce, pt, aad)
+	s.mu.Lock()
+	nonce := append([]byte(nil), s.calcNonce()...)
 	err := s.increment()
+	s.mu.Unlock()
 	if err != nil {
-		for i := range ct {
-			ct[i] = 0
-		}
 		return "", err
 	}
-	ct = append(nonce, ct...)
+
+	ct := append(nonce, s.AEAD.Seal(nil, nonce, pt, aad)...)
 	return base64.StdEncoding.EncodeToString(ct), nil
 }
 
@@ -191,6 +320,8 @@ func (s Sealer) SealZero(aad string) (string, error) {
 // opener decrypts a ciphertext using the specified AEAD encryption algorithm
 type Opener struct {
 	cipher.AEAD
+	suite    LESuite
+	encapKey []byte
 }
 
 // takes a ciphertext and associated data to recover the plaintext. The nonce is extracted from the ciphertext.
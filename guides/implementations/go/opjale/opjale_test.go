@@ -3,7 +3,12 @@ package opjale
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"github.com/cloudflare/circl/hpke"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -31,10 +36,10 @@ func setupAeadTest() (Sealer, Opener, error) {
 	}
 
 	sealer := Sealer{
-		aead, baseNonce, make([]byte, Nn), make([]byte, Nn),
+		aead, baseNonce, make([]byte, Nn), make([]byte, Nn), suite, nil, &sync.Mutex{},
 	}
 	opener := Opener{
-		aead,
+		aead, suite, nil,
 	}
 	return sealer, opener, nil
 }
@@ -158,6 +163,233 @@ func TestInvalidLabelDecryption(t *testing.T) {
 	}
 }
 
+func TestNegotiateSuite(t *testing.T) {
+	p256Suite := NewLESuiteWithParams(hpke.KEM_P256_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES256GCM)
+	defaultSuite := NewLESuite()
+
+	offered := []SuiteID{p256Suite.ID(), defaultSuite.ID()}
+	supported := []SuiteID{defaultSuite.ID()}
+
+	got, err := NegotiateSuite(offered, supported)
+	if err != nil {
+		t.Fatalf("negotiation failed: %s", err)
+	}
+	if got.ID() != defaultSuite.ID() {
+		t.Error("negotiated suite does not match the only mutually supported suite")
+	}
+
+	if _, err := NegotiateSuite(offered, []SuiteID{p256Suite.ID()}); err != nil {
+		t.Fatalf("negotiation failed for a suite present in both lists: %s", err)
+	}
+
+	if _, err := NegotiateSuite(nil, supported); err == nil {
+		t.Error("negotiation succeeded when no suite was offered")
+	}
+}
+
+func TestNewReceiverRejectsMismatchedSuite(t *testing.T) {
+	msSuite := NewLESuite()
+	dspSuite := NewLESuite()
+
+	msPK, msSK, err := msSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	dspPK, dspSK, err := dspSuite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	info := []byte("matching-system.example")
+	encapKey, _, err := msSuite.NewSender(msSK, dspPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+
+	otherSuite := NewLESuiteWithParams(hpke.KEM_P256_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES256GCM)
+	if _, err := otherSuite.NewReceiver(msPK, dspSK, info, encapKey); err == nil {
+		t.Error("NewReceiver accepted an encapsulated key sealed under a different suite")
+	}
+}
+
+func setupJWETest(t *testing.T) (Sealer, Sealer, Opener, Opener) {
+	suite := NewLESuite()
+
+	msPK, msSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	dspPK, dspSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	otherDspPK, otherDspSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	info := []byte("matching-system.example")
+	encapKey, sealer, err := suite.NewSender(msSK, dspPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+	otherEncapKey, otherSealer, err := suite.NewSender(msSK, otherDspPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+
+	opener, err := suite.NewReceiver(msPK, dspSK, info, encapKey)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %s", err)
+	}
+	otherOpener, err := suite.NewReceiver(msPK, otherDspSK, info, otherEncapKey)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %s", err)
+	}
+
+	return sealer, otherSealer, opener, otherOpener
+}
+
+func TestSealOneJWECompactRoundTrip(t *testing.T) {
+	sealer, _, opener, _ := setupJWETest(t)
+	aad := "2VwhmTY9MecgWsu6"
+
+	token, err := sealer.SealOneJWE(aad)
+	if err != nil {
+		t.Fatalf("SealOneJWE failed: %s", err)
+	}
+	if len(strings.Split(token, ".")) != 5 {
+		t.Fatalf("compact JWE must have 5 segments, got %q", token)
+	}
+
+	pt, err := opener.OpenJWE(token, aad)
+	if err != nil {
+		t.Fatalf("OpenJWE failed: %s", err)
+	}
+	if !bytes.Equal(pt, []byte{labelOne}) {
+		t.Fatal("plaintext mismatch")
+	}
+
+	if _, err := opener.OpenJWE(token, "wrong-aad"); err == nil {
+		t.Error("OpenJWE succeeded with mismatched aad")
+	}
+}
+
+func TestSealManyJWE(t *testing.T) {
+	sealer, otherSealer, opener, otherOpener := setupJWETest(t)
+	aad := "2VwhmTY9MecgWsu6"
+
+	doc, err := SealManyJWE([]Sealer{sealer, otherSealer}, true, aad)
+	if err != nil {
+		t.Fatalf("SealManyJWE failed: %s", err)
+	}
+
+	pt, err := opener.OpenJWE(doc, aad)
+	if err != nil {
+		t.Fatalf("OpenJWE failed for first recipient: %s", err)
+	}
+	if !bytes.Equal(pt, []byte{labelOne}) {
+		t.Fatal("plaintext mismatch")
+	}
+
+	otherPt, err := otherOpener.OpenJWE(doc, aad)
+	if err != nil {
+		t.Fatalf("OpenJWE failed for second recipient: %s", err)
+	}
+	if !bytes.Equal(otherPt, []byte{labelOne}) {
+		t.Fatal("plaintext mismatch")
+	}
+}
+
+// TestSealOneJWECompactAADIsProtectedHeaderOnly confirms the Compact
+// Serialization's AAD really is exactly ASCII(encoded protected header)
+// per RFC 7516 §5.1 step 14, with no out-of-band AAD folded in -- i.e.
+// it's decryptable by generic JOSE tooling that only knows the standard
+// AAD rule, not this package's aad parameter.
+func TestSealOneJWECompactAADIsProtectedHeaderOnly(t *testing.T) {
+	sealer, _, opener, _ := setupJWETest(t)
+
+	token, err := sealer.SealOneJWE("2VwhmTY9MecgWsu6")
+	if err != nil {
+		t.Fatalf("SealOneJWE failed: %s", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		t.Fatalf("compact JWE must have 5 segments, got %q", token)
+	}
+	protectedB64, ivB64, ctB64, tagB64 := parts[0], parts[2], parts[3], parts[4]
+
+	nonce, err := base64.RawURLEncoding.DecodeString(ivB64)
+	if err != nil {
+		t.Fatalf("decoding iv failed: %s", err)
+	}
+	ct, err := base64.RawURLEncoding.DecodeString(ctB64)
+	if err != nil {
+		t.Fatalf("decoding ciphertext failed: %s", err)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(tagB64)
+	if err != nil {
+		t.Fatalf("decoding tag failed: %s", err)
+	}
+
+	// Generic JOSE tooling has no way to learn this package's aad
+	// parameter; it can only ever compute AAD = ASCII(protectedB64).
+	full := append(append([]byte(nil), ct...), tag...)
+	pt, err := opener.AEAD.Open(nil, nonce, full, []byte(protectedB64))
+	if err != nil {
+		t.Fatalf("decrypting with AAD = protected header alone failed: %s", err)
+	}
+	if !bytes.Equal(pt, []byte{labelOne}) {
+		t.Fatal("plaintext mismatch")
+	}
+}
+
+// TestSealManyJWEJSONMatchesSpecSchema confirms the JSON Serialization
+// has the top-level protected/iv/ciphertext/tag RFC 7516 §7.2 requires
+// for a single shared ciphertext, and that each recipient entry carries
+// only the header/encrypted_key fields §7.2.1 defines -- no per-recipient
+// iv/ciphertext/tag a generic JWE library wouldn't know to look for.
+func TestSealManyJWEJSONMatchesSpecSchema(t *testing.T) {
+	sealer, otherSealer, _, _ := setupJWETest(t)
+
+	doc, err := SealManyJWE([]Sealer{sealer, otherSealer}, false, "2VwhmTY9MecgWsu6")
+	if err != nil {
+		t.Fatalf("SealManyJWE failed: %s", err)
+	}
+
+	var generic map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &generic); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	for _, field := range []string{"protected", "iv", "ciphertext", "tag", "recipients"} {
+		if _, ok := generic[field]; !ok {
+			t.Errorf("JSON Serialization missing top-level %q field", field)
+		}
+	}
+
+	recipients, ok := generic["recipients"].([]interface{})
+	if !ok || len(recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %v", generic["recipients"])
+	}
+	for i, r := range recipients {
+		recipient, ok := r.(map[string]interface{})
+		if !ok {
+			t.Fatalf("recipient %d is not an object", i)
+		}
+		for _, field := range []string{"header", "encrypted_key"} {
+			if _, ok := recipient[field]; !ok {
+				t.Errorf("recipient %d missing %q field", i, field)
+			}
+		}
+		for _, stray := range []string{"iv", "ciphertext", "tag"} {
+			if _, ok := recipient[stray]; ok {
+				t.Errorf("recipient %d has non-conformant top-level %q field", i, stray)
+			}
+		}
+	}
+}
+
 func TestAeadSeqOverflow(t *testing.T) {
 	sealer, opener, err := setupAeadTest()
 	if err != nil {
@@ -0,0 +1,257 @@
+package opjale
+
+import (
+	"bytes"
+	"encoding/base64"
+	"sync"
+	"testing"
+)
+
+func setupStreamTest(t *testing.T) (Sealer, Opener) {
+	suite := NewLESuite()
+	msPK, msSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+	dspPK, dspSK, err := suite.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err)
+	}
+
+	info := []byte("matching-system.example")
+	encapKey, sealer, err := suite.NewSender(msSK, dspPK, info)
+	if err != nil {
+		t.Fatalf("NewSender failed: %s", err)
+	}
+	opener, err := suite.NewReceiver(msPK, dspSK, info, encapKey)
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %s", err)
+	}
+	return sealer, opener
+}
+
+func TestSealOpenStreamRoundTrip(t *testing.T) {
+	sealer, opener := setupStreamTest(t)
+
+	var buf bytes.Buffer
+	lw, err := sealer.SealStream(&buf)
+	if err != nil {
+		t.Fatalf("SealStream failed: %s", err)
+	}
+
+	wantLabels := [][]byte{{labelOne}, {labelZero}, {labelOne}}
+	wantAads := [][]byte{[]byte("txn-1"), []byte("txn-2"), []byte("txn-3")}
+	for i, aad := range wantAads {
+		var err error
+		if wantLabels[i][0] == labelOne {
+			err = lw.WriteOne(aad)
+		} else {
+			err = lw.WriteZero(aad)
+		}
+		if err != nil {
+			t.Fatalf("write record %d failed: %s", i, err)
+		}
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+
+	lr, err := opener.OpenStream(&buf)
+	if err != nil {
+		t.Fatalf("OpenStream failed: %s", err)
+	}
+	encapKey, labels, err := lr.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+	if !bytes.Equal(encapKey, opener.encapKey) {
+		t.Error("ReadAll returned an encapsulated key that doesn't match the opener's")
+	}
+	if len(labels) != len(wantLabels) {
+		t.Fatalf("got %d labels, want %d", len(labels), len(wantLabels))
+	}
+	for i := range wantLabels {
+		if !bytes.Equal(labels[i], wantLabels[i]) {
+			t.Errorf("label %d = %v, want %v", i, labels[i], wantLabels[i])
+		}
+	}
+}
+
+func TestSealBatch(t *testing.T) {
+	sealer, opener := setupStreamTest(t)
+
+	pairs := make([]LabelPair, 200)
+	for i := range pairs {
+		pairs[i] = LabelPair{One: i%2 == 0, Aad: []byte{byte(i)}}
+	}
+
+	cts, err := sealer.SealBatch(pairs)
+	if err != nil {
+		t.Fatalf("SealBatch failed: %s", err)
+	}
+	if len(cts) != len(pairs) {
+		t.Fatalf("got %d ciphertexts, want %d", len(cts), len(pairs))
+	}
+
+	seen := make(map[string]bool, len(cts))
+	Nn := opener.AEAD.NonceSize()
+	for i, ct := range cts {
+		key := string(ct[:Nn])
+		if seen[key] {
+			t.Fatalf("nonce reused within a single SealBatch call at index %d", i)
+		}
+		seen[key] = true
+
+		pt, err := opener.AEAD.Open(nil, ct[:Nn], ct[Nn:], pairs[i].Aad)
+		if err != nil {
+			t.Fatalf("decrypting batch entry %d failed: %s", i, err)
+		}
+		wantLabel := byte(labelZero)
+		if pairs[i].One {
+			wantLabel = labelOne
+		}
+		if !bytes.Equal(pt, []byte{wantLabel}) {
+			t.Errorf("batch entry %d: plaintext mismatch", i)
+		}
+	}
+}
+
+func TestSealBatchDoesNotReuseNoncesAcrossCalls(t *testing.T) {
+	sealer, _ := setupStreamTest(t)
+
+	seen := make(map[string]bool)
+	for call := 0; call < 3; call++ {
+		pairs := []LabelPair{{One: true, Aad: []byte("aad")}, {One: false, Aad: []byte("aad")}}
+		cts, err := sealer.SealBatch(pairs)
+		if err != nil {
+			t.Fatalf("SealBatch failed: %s", err)
+		}
+		Nn := sealer.AEAD.NonceSize()
+		for _, ct := range cts {
+			key := string(ct[:Nn])
+			if seen[key] {
+				t.Fatalf("nonce reused across separate SealBatch calls on the same sealer")
+			}
+			seen[key] = true
+		}
+	}
+
+	if _, err := sealer.SealOne("aad"); err != nil {
+		t.Fatalf("SealOne failed: %s", err)
+	}
+}
+
+func TestSealBatchConcurrentCallsDoNotReuseNonces(t *testing.T) {
+	sealer, opener := setupStreamTest(t)
+
+	const callers, perCaller = 4, 50
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		wg   sync.WaitGroup
+	)
+	wg.Add(callers)
+	for c := 0; c < callers; c++ {
+		go func() {
+			defer wg.Done()
+
+			pairs := make([]LabelPair, perCaller)
+			for i := range pairs {
+				pairs[i] = LabelPair{One: i%2 == 0, Aad: []byte{byte(i)}}
+			}
+			cts, err := sealer.SealBatch(pairs)
+			if err != nil {
+				t.Errorf("SealBatch failed: %s", err)
+				return
+			}
+
+			Nn := opener.AEAD.NonceSize()
+			mu.Lock()
+			defer mu.Unlock()
+			for _, ct := range cts {
+				key := string(ct[:Nn])
+				if seen[key] {
+					t.Errorf("nonce reused across concurrent SealBatch calls on the same sealer")
+				}
+				seen[key] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != callers*perCaller {
+		t.Fatalf("got %d distinct nonces, want %d", len(seen), callers*perCaller)
+	}
+}
+
+func TestSealBatchConcurrentWithSealOneDoesNotReuseNonces(t *testing.T) {
+	sealer, opener := setupStreamTest(t)
+
+	const batches, singles = 4, 100
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		wg   sync.WaitGroup
+	)
+
+	wg.Add(batches)
+	for c := 0; c < batches; c++ {
+		go func() {
+			defer wg.Done()
+
+			pairs := make([]LabelPair, 20)
+			for i := range pairs {
+				pairs[i] = LabelPair{One: i%2 == 0, Aad: []byte{byte(i)}}
+			}
+			cts, err := sealer.SealBatch(pairs)
+			if err != nil {
+				t.Errorf("SealBatch failed: %s", err)
+				return
+			}
+
+			Nn := opener.AEAD.NonceSize()
+			mu.Lock()
+			defer mu.Unlock()
+			for _, ct := range cts {
+				key := string(ct[:Nn])
+				if seen[key] {
+					t.Errorf("nonce reused between SealBatch and SealOne on the same sealer")
+				}
+				seen[key] = true
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		Nn := opener.AEAD.NonceSize()
+		for i := 0; i < singles; i++ {
+			ct, err := sealer.SealOne("aad")
+			if err != nil {
+				t.Errorf("SealOne failed: %s", err)
+				return
+			}
+			ctBytes, err := base64.StdEncoding.DecodeString(ct)
+			if err != nil {
+				t.Errorf("decoding SealOne ciphertext failed: %s", err)
+				return
+			}
+
+			mu.Lock()
+			key := string(ctBytes[:Nn])
+			if seen[key] {
+				t.Errorf("nonce reused between SealOne and SealBatch on the same sealer")
+			}
+			seen[key] = true
+			mu.Unlock()
+		}
+	}()
+
+	wg.Wait()
+
+	if len(seen) != batches*20+singles {
+		t.Fatalf("got %d distinct nonces, want %d", len(seen), batches*20+singles)
+	}
+}